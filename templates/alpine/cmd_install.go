@@ -0,0 +1,19 @@
+package alpine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/megamsys/libmegdc/templates"
+)
+
+// InstallPackages returns a command that installs the given apk package
+// names on the target using "apk add --no-cache", so no local package
+// index is left cached on what are typically disk-constrained Alpine
+// hosts.
+func InstallPackages(pkgs ...string) *templates.ShellCommand {
+	return &templates.ShellCommand{
+		Cmd:     fmt.Sprintf("apk add --no-cache %s", strings.Join(pkgs, " ")),
+		LogLine: fmt.Sprintf("[APK    ] %s", strings.Join(pkgs, " ")),
+	}
+}
@@ -0,0 +1,107 @@
+package alpine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/megamsys/libmegdc/templates"
+)
+
+// MaxDiffSize bounds how large a file Plan() will attempt to diff
+// textually; see templates.MaxDiffSize.
+const MaxDiffSize = templates.MaxDiffSize
+
+// ChangeAction, Change, Execer and Planner are shared with the ubuntu
+// package so both can be walked by templates.PlanAll; see their
+// definitions in the templates package for documentation.
+type (
+	ChangeAction = templates.ChangeAction
+	Change       = templates.Change
+	Execer       = templates.Execer
+	Planner      = templates.Planner
+)
+
+const (
+	ActionCreate = templates.ActionCreate
+	ActionUpdate = templates.ActionUpdate
+	ActionNoop   = templates.ActionNoop
+	ActionChmod  = templates.ActionChmod
+	ActionChown  = templates.ActionChown
+)
+
+// Plan reports what writing fc would do to target, the same way
+// ubuntu.FileCommand.Plan does.
+func (fc *FileCommand) Plan(target Execer) (Change, error) {
+	hash := sha256.Sum256([]byte(fc.Content))
+	newDigest := hex.EncodeToString(hash[:])
+
+	oldDigest, oldMode, oldOwner, exists, e := templates.StatRemote(target, fc.Path)
+	if e != nil {
+		return Change{}, e
+	}
+
+	change := Change{
+		Path:      fc.Path,
+		OldSHA256: oldDigest,
+		NewSHA256: newDigest,
+		OldMode:   oldMode,
+		NewMode:   fc.Permissions,
+		OldOwner:  oldOwner,
+		NewOwner:  fc.Owner,
+	}
+
+	switch {
+	case !exists:
+		change.Action = ActionCreate
+	case oldDigest != newDigest:
+		change.Action = ActionUpdate
+		change.UnifiedDiff = templates.UnifiedDiff(target, fc.Path, fc.Content)
+	case fc.Permissions > 0 && oldMode != fc.Permissions:
+		change.Action = ActionChmod
+	case fc.Owner != "" && oldOwner != fc.Owner:
+		change.Action = ActionChown
+	default:
+		change.Action = ActionNoop
+	}
+
+	return change, nil
+}
+
+// Plan reports what sending fsc.Source to fsc.Target would do, the same
+// way ubuntu.FileSendCommand.Plan does.
+func (fsc *FileSendCommand) Plan(target Execer) (Change, error) {
+	newDigest := fsc.sourceSHA256()
+
+	oldDigest, oldMode, oldOwner, exists, e := templates.StatRemote(target, fsc.Target)
+	if e != nil {
+		return Change{}, e
+	}
+
+	change := Change{
+		Path:      fsc.Target,
+		OldSHA256: oldDigest,
+		NewSHA256: newDigest,
+		OldMode:   oldMode,
+		NewMode:   fsc.Permissions,
+		OldOwner:  oldOwner,
+		NewOwner:  fsc.Owner,
+	}
+
+	switch {
+	case !exists:
+		change.Action = ActionCreate
+	case oldDigest != newDigest:
+		change.Action = ActionUpdate
+		if content, re := templates.ReadCapped(fsc.Source, MaxDiffSize); re == nil {
+			change.UnifiedDiff = templates.UnifiedDiff(target, fsc.Target, content)
+		}
+	case fsc.Permissions > 0 && oldMode != fsc.Permissions:
+		change.Action = ActionChmod
+	case fsc.Owner != "" && oldOwner != fsc.Owner:
+		change.Action = ActionChown
+	default:
+		change.Action = ActionNoop
+	}
+
+	return change, nil
+}
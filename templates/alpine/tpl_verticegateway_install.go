@@ -0,0 +1,63 @@
+/*
+** Copyright [2013-2016] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+package alpine
+
+import (
+	"github.com/megamsys/libmegdc/templates"
+	"github.com/megamsys/urknall"
+)
+
+// HOST is the Template.Options key carrying the target's host IP, the
+// same key ubuntu's templates read.
+const HOST = "host"
+
+var alpinegatewayinstall *AlpineGatewayInstall
+
+func init() {
+	alpinegatewayinstall = &AlpineGatewayInstall{}
+	templates.Register("AlpineGatewayInstall", alpinegatewayinstall)
+}
+
+type AlpineGatewayInstall struct {
+	hostip string
+}
+
+func (tpl *AlpineGatewayInstall) Render(p urknall.Package) {
+	p.AddTemplate("verticegateway", &AlpineGatewayInstallTemplate{
+		hostip: tpl.hostip,
+	})
+}
+
+func (tpl *AlpineGatewayInstall) Options(t *templates.Template) {
+	if host, ok := t.Options[HOST]; ok {
+		tpl.hostip = host
+	}
+}
+
+func (tpl *AlpineGatewayInstall) Run(target urknall.Target, inputs map[string]string) error {
+	return urknall.Run(target, &AlpineGatewayInstall{}, inputs)
+}
+
+type AlpineGatewayInstallTemplate struct {
+	hostip string
+}
+
+func (m *AlpineGatewayInstallTemplate) Render(pkg urknall.Package) {
+	pkg.AddCommands("install",
+		InstallPackages("verticegateway"),
+	)
+}
@@ -0,0 +1,31 @@
+package templates
+
+import "fmt"
+
+// ShellCommand is a bare, pre-rendered command: Shell() returns Cmd
+// verbatim. It backs the small fixed commands (package installs,
+// post-install snippets) that don't need
+// FileCommand's templating or content-embedding machinery. It is exported
+// so the OS-specific template packages (ubuntu, alpine) can share it
+// instead of keeping their own copies that drift independently.
+type ShellCommand struct {
+	Cmd     string
+	LogLine string
+}
+
+func (c *ShellCommand) Render(i interface{}) {}
+
+func (c *ShellCommand) Validate() error {
+	if c.Cmd == "" {
+		return fmt.Errorf("no command given")
+	}
+	return nil
+}
+
+func (c *ShellCommand) Shell() string {
+	return c.Cmd
+}
+
+func (c *ShellCommand) Logging() string {
+	return c.LogLine
+}
@@ -0,0 +1,179 @@
+// Package fileutil holds the file-digest and chunked-transfer helpers
+// shared by the ubuntu and alpine template packages' FileSendCommand
+// implementations, so fixes to this logic only need to happen once instead
+// of drifting independently between two copies.
+package fileutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ChunkReader exposes a file's content as a sequence of fixed-size,
+// digest-tagged blocks so it can be streamed to a chunked remote driver
+// without holding the whole file in memory.
+type ChunkReader interface {
+	// Next returns the next block and its sha256 hex digest, or io.EOF
+	// once the source is exhausted.
+	Next() (block []byte, sha256hex string, err error)
+	// Total returns the source's total size in bytes.
+	Total() int64
+}
+
+// FileChunkReader is the ChunkReader used for a FileSendCommand's Source.
+type FileChunkReader struct {
+	fh        *os.File
+	chunkSize int64
+	total     int64
+}
+
+// NewFileChunkReader opens path for chunked reading, seeking to offset
+// first so a resumed transfer only reads (and therefore only sends) the
+// bytes the remote side doesn't already have.
+func NewFileChunkReader(path string, chunkSize, offset int64) (*FileChunkReader, error) {
+	fh, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	fi, e := fh.Stat()
+	if e != nil {
+		fh.Close()
+		return nil, e
+	}
+	if offset > 0 {
+		if _, e := fh.Seek(offset, io.SeekStart); e != nil {
+			fh.Close()
+			return nil, e
+		}
+	}
+	return &FileChunkReader{fh: fh, chunkSize: chunkSize, total: fi.Size()}, nil
+}
+
+func (r *FileChunkReader) Total() int64 {
+	return r.total
+}
+
+func (r *FileChunkReader) Next() ([]byte, string, error) {
+	buf := make([]byte, r.chunkSize)
+	n, e := io.ReadFull(r.fh, buf)
+	if n == 0 {
+		r.fh.Close()
+		if e == io.EOF {
+			return nil, "", io.EOF
+		}
+		return nil, "", e
+	}
+	if e == io.ErrUnexpectedEOF {
+		e = nil // final, short block
+	}
+	buf = buf[:n]
+	sum := sha256.Sum256(buf)
+	return buf, hex.EncodeToString(sum[:]), e
+}
+
+// SHA256File hashes the file at path, used to decide whether a target
+// already holds matching content and to re-verify a transfer once it has
+// landed.
+func SHA256File(path string) (string, error) {
+	fh, e := os.Open(path)
+	if e != nil {
+		return "", e
+	}
+	defer fh.Close()
+
+	hash := sha256.New()
+	if _, e = io.Copy(hash, fh); e != nil {
+		return "", e
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ChunkedDriverScript renders the remote shell driver that reads the
+// "<size> <sha256>" framed block sequence produced by ChunkedInput off
+// stdin, appending each block's payload to a ".part" file next to target
+// and verifying its digest as it lands.
+//
+// Before reading anything it truncates any pre-existing ".part" file down
+// to the last complete chunkSize-aligned boundary: a previous attempt may
+// have been killed mid-append, leaving a partial, non-aligned tail that
+// doesn't correspond to any whole block. ResumeOffsetCommand computes that
+// same aligned boundary on the caller's side so Source is re-read from
+// exactly where the driver will resume appending.
+//
+// Per-block digests only prove a block was received correctly in
+// isolation; they can't catch bookkeeping drift between the local and
+// remote offsets. So before the final mv, the fully assembled ".part" file
+// is re-hashed against the source's whole-file digest, and the driver
+// refuses to ship anything that doesn't match exactly.
+func ChunkedDriverScript(target string, chunkSize int64, fullDigest string) string {
+	part := target + ".part"
+	return fmt.Sprintf(`set -e
+part=%q
+touch "$part"
+have=$(stat -c%%s "$part")
+aligned=$(( (have / %d) * %d ))
+if [ "$aligned" -lt "$have" ]; then truncate -s "$aligned" "$part"; fi
+while read -r size digest; do
+  [ -z "$size" ] && break
+  tmp=$(mktemp)
+  head -c "$size" > "$tmp"
+  actual=$(sha256sum "$tmp" | cut -d' ' -f1)
+  if [ "$actual" != "$digest" ]; then echo "chunk digest mismatch for %s" >&2; rm -f "$tmp"; exit 1; fi
+  cat "$tmp" >> "$part"
+  rm -f "$tmp"
+done
+full=$(sha256sum "$part" | cut -d' ' -f1)
+if [ "$full" != %q ]; then echo "assembled file digest mismatch for %s" >&2; rm -f "$part"; exit 1; fi
+mv "$part" %s`, part, chunkSize, chunkSize, target, fullDigest, target, target)
+}
+
+// ResumeOffsetCommand renders the command ResumeOffset runs on the target
+// to learn how many chunkSize-aligned bytes of target+".part" already
+// exist there, so the caller can resume reading Source from that point
+// instead of from byte 0.
+func ResumeOffsetCommand(target string, chunkSize int64) string {
+	return fmt.Sprintf(
+		"have=$(stat -c%%s %s 2>/dev/null || echo 0); echo $(( (have / %d) * %d ))",
+		target+".part", chunkSize, chunkSize)
+}
+
+// ChunkedInput streams chunks as the "<size> <sha256>\n<payload>" framed
+// block sequence ChunkedDriverScript's driver expects, firing progress
+// (when non-nil) after each block has been written to the pipe. sent seeds
+// the running total so progress reflects the whole transfer, not just
+// what chunks still has left to send after a resume.
+func ChunkedInput(chunks ChunkReader, sent int64, progress func(sent, total int64)) io.ReadCloser {
+	pr, pw := io.Pipe()
+	total := chunks.Total()
+
+	go func() {
+		for {
+			block, digest, e := chunks.Next()
+			if e == io.EOF {
+				pw.Close()
+				return
+			}
+			if e != nil {
+				pw.CloseWithError(e)
+				return
+			}
+			if _, we := fmt.Fprintf(pw, "%d %s\n", len(block), digest); we != nil {
+				pw.CloseWithError(we)
+				return
+			}
+			if _, we := pw.Write(block); we != nil {
+				pw.CloseWithError(we)
+				return
+			}
+			sent += int64(len(block))
+			if progress != nil {
+				progress(sent, total)
+			}
+		}
+	}()
+
+	return pr
+}
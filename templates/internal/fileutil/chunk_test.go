@@ -0,0 +1,205 @@
+package fileutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, content []byte) string {
+	t.Helper()
+	fh, e := ioutil.TempFile("", "fileutil-test-")
+	if e != nil {
+		t.Fatalf("TempFile: %v", e)
+	}
+	defer fh.Close()
+	if _, e := fh.Write(content); e != nil {
+		t.Fatalf("Write: %v", e)
+	}
+	t.Cleanup(func() { os.Remove(fh.Name()) })
+	return fh.Name()
+}
+
+func TestFileChunkReaderSplitsIntoExpectedBlocks(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 10)
+	path := writeTempFile(t, content)
+
+	r, e := NewFileChunkReader(path, 3, 0)
+	if e != nil {
+		t.Fatalf("NewFileChunkReader: %v", e)
+	}
+	if r.Total() != 10 {
+		t.Fatalf("Total() = %d, want 10", r.Total())
+	}
+
+	var sizes []int
+	for {
+		block, digest, e := r.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			t.Fatalf("Next: %v", e)
+		}
+		sum := sha256.Sum256(block)
+		if digest != hex.EncodeToString(sum[:]) {
+			t.Fatalf("digest mismatch for block %q", block)
+		}
+		sizes = append(sizes, len(block))
+	}
+
+	if got, want := sizes, []int{3, 3, 3, 1}; !equalInts(got, want) {
+		t.Fatalf("block sizes = %v, want %v", got, want)
+	}
+}
+
+func TestFileChunkReaderResumesFromOffset(t *testing.T) {
+	content := []byte("0123456789")
+	path := writeTempFile(t, content)
+
+	// Resuming from offset 6 should only yield the remaining 4 bytes,
+	// not re-read the whole file.
+	r, e := NewFileChunkReader(path, 3, 6)
+	if e != nil {
+		t.Fatalf("NewFileChunkReader: %v", e)
+	}
+
+	var got bytes.Buffer
+	for {
+		block, _, e := r.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			t.Fatalf("Next: %v", e)
+		}
+		got.Write(block)
+	}
+
+	if got.String() != "6789" {
+		t.Fatalf("resumed content = %q, want %q", got.String(), "6789")
+	}
+}
+
+func TestSHA256FileMatchesStdlibDigest(t *testing.T) {
+	content := []byte("hello, chunked world")
+	path := writeTempFile(t, content)
+
+	digest, e := SHA256File(path)
+	if e != nil {
+		t.Fatalf("SHA256File: %v", e)
+	}
+
+	sum := sha256.Sum256(content)
+	if want := hex.EncodeToString(sum[:]); digest != want {
+		t.Fatalf("SHA256File = %s, want %s", digest, want)
+	}
+}
+
+// TestResumeOffsetCommandAlignsDownToChunkBoundary exercises the same
+// integer arithmetic the shell snippet performs, guarding against the
+// resume-corruption bug where a ".part" file truncated mid-chunk was
+// treated as if it held a whole number of chunks.
+func TestResumeOffsetCommandAlignsDownToChunkBoundary(t *testing.T) {
+	cases := []struct {
+		have, chunkSize, wantAligned int64
+	}{
+		{have: 0, chunkSize: 3000, wantAligned: 0},
+		{have: 3000, chunkSize: 3000, wantAligned: 3000},
+		{have: 5000, chunkSize: 3000, wantAligned: 3000}, // misaligned tail dropped
+		{have: 8999, chunkSize: 3000, wantAligned: 6000},
+	}
+
+	for _, c := range cases {
+		got := (c.have / c.chunkSize) * c.chunkSize
+		if got != c.wantAligned {
+			t.Errorf("align(have=%d, chunkSize=%d) = %d, want %d", c.have, c.chunkSize, got, c.wantAligned)
+		}
+
+		size := strconv.FormatInt(c.chunkSize, 10)
+		cmd := ResumeOffsetCommand("/opt/app.bin", c.chunkSize)
+		if want := "echo $(( (have / " + size + ") * " + size + " ))"; !strings.Contains(cmd, want) {
+			t.Errorf("ResumeOffsetCommand(chunkSize=%d) = %q, missing %q", c.chunkSize, cmd, want)
+		}
+	}
+}
+
+func TestChunkedDriverScriptEmbedsTargetAndDigest(t *testing.T) {
+	script := ChunkedDriverScript("/opt/app.bin", 4096, "deadbeef")
+
+	for _, want := range []string{
+		`part="/opt/app.bin.part"`,
+		"deadbeef",
+		`mv "$part" /opt/app.bin`,
+		"full=$(sha256sum",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestChunkedInputReproducesSourceBytes(t *testing.T) {
+	content := bytes.Repeat([]byte("xy"), 5) // 10 bytes
+	path := writeTempFile(t, content)
+
+	r, e := NewFileChunkReader(path, 4, 0)
+	if e != nil {
+		t.Fatalf("NewFileChunkReader: %v", e)
+	}
+
+	var sent []int64
+	rc := ChunkedInput(r, 0, func(bytesSent, bytesTotal int64) { sent = append(sent, bytesSent) })
+
+	framed, e := ioutil.ReadAll(rc)
+	if e != nil {
+		t.Fatalf("ReadAll: %v", e)
+	}
+
+	// Re-parse the "<size> <sha256>\n<payload>" framing and check the
+	// reassembled payload matches the source exactly.
+	var reassembled bytes.Buffer
+	rest := framed
+	for len(rest) > 0 {
+		nl := bytes.IndexByte(rest, '\n')
+		if nl < 0 {
+			t.Fatalf("truncated frame header in %q", rest)
+		}
+		header := strings.Fields(string(rest[:nl]))
+		if len(header) != 2 {
+			t.Fatalf("bad frame header %q", rest[:nl])
+		}
+		size, e := strconv.Atoi(header[0])
+		if e != nil {
+			t.Fatalf("bad frame size %q: %v", header[0], e)
+		}
+		payload := rest[nl+1 : nl+1+size]
+		reassembled.Write(payload)
+		rest = rest[nl+1+size:]
+	}
+
+	if !bytes.Equal(reassembled.Bytes(), content) {
+		t.Fatalf("reassembled = %q, want %q", reassembled.Bytes(), content)
+	}
+	if len(sent) == 0 || sent[len(sent)-1] != int64(len(content)) {
+		t.Fatalf("progress callback final sent = %v, want final value %d", sent, len(content))
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
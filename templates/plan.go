@@ -0,0 +1,236 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxDiffSize bounds how large a file Plan() will attempt to diff
+// textually, in bytes. Larger files still get an Action and digest
+// comparison, just no UnifiedDiff, since diffing them is neither cheap nor
+// very readable in a terminal.
+const MaxDiffSize = 64 * 1024
+
+// MaxDiffLines additionally bounds the diff by line count. A file well
+// within MaxDiffSize can still split into tens of thousands of short
+// lines, and the LCS-based diff below is O(lines(a) * lines(b)) in both
+// time and memory: two ~65k-line files (trivially within the byte cap)
+// would otherwise try to allocate tens of gigabytes computing a "preview"
+// diff. Files with more lines than this on either side still get an
+// Action and digest comparison, just no UnifiedDiff.
+const MaxDiffLines = 2000
+
+// ChangeAction describes what, if anything, applying a command would do
+// to a target.
+type ChangeAction string
+
+const (
+	ActionCreate ChangeAction = "create"
+	ActionUpdate ChangeAction = "update"
+	ActionNoop   ChangeAction = "noop"
+	ActionChmod  ChangeAction = "chmod"
+	ActionChown  ChangeAction = "chown"
+)
+
+// Change is what Plan() returns: a description of the effect a command
+// would have on a target, without actually having it.
+type Change struct {
+	Path        string
+	Action      ChangeAction
+	OldSHA256   string
+	NewSHA256   string
+	UnifiedDiff string
+	OldMode     os.FileMode
+	NewMode     os.FileMode
+	OldOwner    string
+	NewOwner    string
+}
+
+// Execer is the narrow slice of urknall.Target's capability Plan() needs:
+// running a single command on the target and getting its combined output
+// back. Any urknall.Target that can do this satisfies it, so this package
+// doesn't need to depend on urknall.Target's full shape just to plan.
+type Execer interface {
+	Exec(cmd string) (string, error)
+}
+
+// Planner is implemented by commands that can describe their effect on a
+// target instead of performing it. A Plan-style run walks a package's
+// commands and, for each one implementing Planner, collects its Change
+// instead of executing it.
+type Planner interface {
+	Plan(target Execer) (Change, error)
+}
+
+// PlanAll walks cmds in order, collecting a Change from each one that
+// implements Planner; commands that don't (e.g. a bare ShellCommand) are
+// skipped rather than erroring, so the same command list built for
+// urknall.Package.AddCommands can be passed straight through. This is the
+// aggregation entry point a "what would change" mode needs: urknall.Target
+// and urknall.Package are defined in another repo and urknall.Package has
+// no API for reading commands back out once added, so the walk has to
+// happen over the list the caller already has in hand rather than over a
+// urknall.Package itself.
+func PlanAll(target Execer, cmds ...interface{}) ([]Change, error) {
+	changes := make([]Change, 0, len(cmds))
+	for _, c := range cmds {
+		p, ok := c.(Planner)
+		if !ok {
+			continue
+		}
+		change, e := p.Plan(target)
+		if e != nil {
+			return nil, e
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// StatRemote reads path's current sha256, mode and owner on target. The
+// returned exists is false when path doesn't exist yet, in which case the
+// other return values are zero.
+func StatRemote(target Execer, path string) (digest string, mode os.FileMode, owner string, exists bool, err error) {
+	out, e := target.Exec(fmt.Sprintf(
+		"if [ -e %s ]; then sha256sum %s | cut -d' ' -f1; stat -c '%%a %%U' %s; fi", path, path, path))
+	if e != nil {
+		return "", 0, "", false, e
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 || lines[0] == "" {
+		return "", 0, "", false, nil
+	}
+
+	fields := strings.Fields(lines[1])
+	if len(fields) != 2 {
+		return "", 0, "", false, fmt.Errorf("unexpected stat output %q for %s", lines[1], path)
+	}
+
+	m, e := strconv.ParseUint(fields[0], 8, 32)
+	if e != nil {
+		return "", 0, "", false, e
+	}
+
+	return lines[0], os.FileMode(m), fields[1], true, nil
+}
+
+// ReadCapped reads path whole, refusing files larger than cap bytes so a
+// stray multi-gigabyte source can't be pulled entirely into memory just
+// to attempt a diff.
+func ReadCapped(path string, cap int64) (string, error) {
+	fi, e := os.Stat(path)
+	if e != nil {
+		return "", e
+	}
+	if fi.Size() > cap {
+		return "", fmt.Errorf("%s exceeds diff size cap of %d bytes", path, cap)
+	}
+
+	b, e := ioutil.ReadFile(path)
+	if e != nil {
+		return "", e
+	}
+	return string(b), nil
+}
+
+// UnifiedDiff fetches path's current content from target and returns a
+// line-based unified diff against newContent, or "" when a diff can't or
+// shouldn't be produced (either side too large by bytes or by line count,
+// or not valid UTF-8 text).
+func UnifiedDiff(target Execer, path, newContent string) string {
+	if int64(len(newContent)) > MaxDiffSize {
+		return ""
+	}
+
+	old, e := target.Exec(fmt.Sprintf("cat %s", path))
+	if e != nil || int64(len(old)) > MaxDiffSize {
+		return ""
+	}
+	if !utf8.ValidString(old) || !utf8.ValidString(newContent) {
+		return ""
+	}
+
+	return lineDiff(path, old, newContent)
+}
+
+// lineDiff renders a unified-style diff between oldContent and newContent,
+// aligning unchanged lines around their longest common subsequence. It
+// refuses to diff when either side splits into more than MaxDiffLines
+// lines, since the LCS computation below is O(lines(a) * lines(b)) in
+// both time and memory.
+func lineDiff(path, oldContent, newContent string) string {
+	oldLines := strings.Split(oldContent, "\n")
+	newLines := strings.Split(newContent, "\n")
+	if len(oldLines) > MaxDiffLines || len(newLines) > MaxDiffLines {
+		return ""
+	}
+
+	lcs := longestCommonSubsequence(oldLines, newLines)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- a%s\n+++ b%s\n", path, path)
+
+	oi, ni, li := 0, 0, 0
+	for oi < len(oldLines) || ni < len(newLines) {
+		switch {
+		case li < len(lcs) && oi < len(oldLines) && ni < len(newLines) && oldLines[oi] == lcs[li] && newLines[ni] == lcs[li]:
+			fmt.Fprintf(buf, " %s\n", oldLines[oi])
+			oi++
+			ni++
+			li++
+		case oi < len(oldLines) && (li >= len(lcs) || oldLines[oi] != lcs[li]):
+			fmt.Fprintf(buf, "-%s\n", oldLines[oi])
+			oi++
+		default:
+			fmt.Fprintf(buf, "+%s\n", newLines[ni])
+			ni++
+		}
+	}
+
+	return buf.String()
+}
+
+// longestCommonSubsequence returns the LCS of a and b, used by lineDiff to
+// decide which lines are unchanged. Callers must keep len(a) and len(b)
+// within MaxDiffLines: this allocates an (n+1)x(m+1) int matrix.
+func longestCommonSubsequence(a, b []string) []string {
+	n, m := len(a), len(b)
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] >= dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	lcs := make([]string, 0, dp[0][0])
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			lcs = append(lcs, a[i])
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return lcs
+}
@@ -0,0 +1,118 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// stubExecer is a fake Execer for tests that never talks to a real target:
+// it answers "cat <path>" with a canned file and everything else with "".
+type stubExecer struct {
+	files map[string]string
+}
+
+func (s *stubExecer) Exec(cmd string) (string, error) {
+	for path, content := range s.files {
+		if cmd == fmt.Sprintf("cat %s", path) {
+			return content, nil
+		}
+	}
+	return "", nil
+}
+
+func repeatLines(prefix string, n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = prefix + strconv.Itoa(i)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestUnifiedDiffWithinLineCapProducesDiff(t *testing.T) {
+	old := repeatLines("line", 5)
+	target := &stubExecer{files: map[string]string{"/f": old}}
+
+	diff := UnifiedDiff(target, "/f", repeatLines("line", 5)+"\nextra")
+	if diff == "" {
+		t.Fatal("expected a non-empty diff for small inputs")
+	}
+	if !strings.Contains(diff, "+extra") {
+		t.Fatalf("diff missing added line:\n%s", diff)
+	}
+}
+
+func TestUnifiedDiffRefusesWhenOldExceedsLineCap(t *testing.T) {
+	old := repeatLines("line", MaxDiffLines+1)
+	target := &stubExecer{files: map[string]string{"/f": old}}
+
+	diff := UnifiedDiff(target, "/f", "line0\nline1")
+	if diff != "" {
+		t.Fatalf("expected no diff when old content exceeds MaxDiffLines, got %d bytes", len(diff))
+	}
+}
+
+func TestUnifiedDiffRefusesWhenNewExceedsLineCap(t *testing.T) {
+	old := "line0\nline1"
+	target := &stubExecer{files: map[string]string{"/f": old}}
+
+	diff := UnifiedDiff(target, "/f", repeatLines("line", MaxDiffLines+1))
+	if diff != "" {
+		t.Fatalf("expected no diff when new content exceeds MaxDiffLines, got %d bytes", len(diff))
+	}
+}
+
+// fakePlannerCommand implements Planner and returns a Change carrying its
+// own path, so ordering can be asserted.
+type fakePlannerCommand struct {
+	path   string
+	action ChangeAction
+}
+
+func (f *fakePlannerCommand) Plan(target Execer) (Change, error) {
+	return Change{Path: f.path, Action: f.action}, nil
+}
+
+// fakeBareCommand does NOT implement Planner, standing in for something
+// like a bare ShellCommand in a real command list.
+type fakeBareCommand struct{}
+
+func TestPlanAllSkipsNonPlannersAndPreservesOrder(t *testing.T) {
+	target := &stubExecer{}
+	cmds := []interface{}{
+		&fakePlannerCommand{path: "/a", action: ActionCreate},
+		&fakeBareCommand{},
+		&fakePlannerCommand{path: "/b", action: ActionNoop},
+	}
+
+	changes, e := PlanAll(target, cmds...)
+	if e != nil {
+		t.Fatalf("PlanAll: %v", e)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("len(changes) = %d, want 2 (non-Planner skipped)", len(changes))
+	}
+	if changes[0].Path != "/a" || changes[1].Path != "/b" {
+		t.Fatalf("changes out of order: %+v", changes)
+	}
+}
+
+func TestPlanAllPropagatesError(t *testing.T) {
+	boom := fmt.Errorf("boom")
+	cmds := []interface{}{
+		&erroringPlannerCommand{err: boom},
+	}
+
+	_, e := PlanAll(&stubExecer{}, cmds...)
+	if e != boom {
+		t.Fatalf("PlanAll error = %v, want %v", e, boom)
+	}
+}
+
+type erroringPlannerCommand struct{ err error }
+
+func (e *erroringPlannerCommand) Plan(target Execer) (Change, error) {
+	return Change{}, e.err
+}
@@ -0,0 +1,93 @@
+/*
+** Copyright [2013-2016] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+// Package templates holds the registry of named provisioning templates
+// (e.g. "UbuntuGatewayInstall", "AlpineGatewayInstall") contributed by the
+// OS-specific packages (ubuntu, alpine, ...), so callers can look a
+// template up by name and run it without importing every OS package.
+package templates
+
+import (
+	"os"
+
+	"github.com/megamsys/urknall"
+)
+
+// TargetOS selects which OS-specific variant of a template a caller wants,
+// so a single call site can dispatch to the ubuntu or alpine renderer for
+// the same logical install without branching on OS itself.
+type TargetOS string
+
+const (
+	Ubuntu TargetOS = "ubuntu"
+	Alpine TargetOS = "alpine"
+)
+
+// Template carries the options a registered template needs to render
+// itself, along with the TargetOS selector used to pick between OS
+// variants of the same logical install.
+type Template struct {
+	OS      TargetOS
+	Options map[string]string
+}
+
+// Installable is implemented by every template registered via Register.
+type Installable interface {
+	// Options lets the template pull whatever it needs out of t.Options
+	// (a host IP, a version pin, ...).
+	Options(t *Template)
+	// Render adds this template's commands/packages to pkg.
+	Render(pkg urknall.Package)
+	// Run executes the template against target, passing through
+	// caller-supplied rendering inputs.
+	Run(target urknall.Target, inputs map[string]string) error
+}
+
+var registry = map[string]Installable{}
+
+// Register makes tpl available for later lookup under name. OS-specific
+// packages call this from their init() functions.
+func Register(name string, tpl Installable) {
+	registry[name] = tpl
+}
+
+// Get returns the template registered under name, if any.
+func Get(name string) (Installable, bool) {
+	tpl, ok := registry[name]
+	return tpl, ok
+}
+
+// FileWriterFunc constructs an OS-specific, content-addressed file-write
+// command (ubuntu.WriteFileWithChecksum, alpine.WriteFileWithChecksum, ...)
+// from content that has already been fetched and verified. Templates that
+// describe files generically, without caring which OS they end up on (see
+// ManifestFile), go through this instead of importing every OS package
+// directly.
+type FileWriterFunc func(path, content, sha256hex, owner string, perm os.FileMode) urknall.Command
+
+var fileWriters = map[TargetOS]FileWriterFunc{}
+
+// RegisterFileWriter makes fn the FileWriterFunc used for t. OS-specific
+// packages call this from their init() functions, mirroring Register.
+func RegisterFileWriter(t TargetOS, fn FileWriterFunc) {
+	fileWriters[t] = fn
+}
+
+// FileWriter returns the FileWriterFunc registered for t, if any.
+func FileWriter(t TargetOS) (FileWriterFunc, bool) {
+	fn, ok := fileWriters[t]
+	return fn, ok
+}
@@ -0,0 +1,86 @@
+package templates
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func manifestSHA256(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+const validManifestYAML = `
+version: 1
+name: test-manifest-valid
+description: a manifest used only by tests
+files:
+  - path: /opt/app/config.yml
+    uri: https://example.invalid/config.yml
+    sha256: deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef
+    owner: root
+    mode: "0644"
+apt_packages:
+  - curl
+`
+
+func TestLoadManifestAcceptsValidManifestAndRegistersIt(t *testing.T) {
+	body := []byte(validManifestYAML)
+	tpl, e := loadManifest(body, manifestSHA256(body))
+	if e != nil {
+		t.Fatalf("loadManifest: %v", e)
+	}
+	if tpl == nil {
+		t.Fatal("loadManifest returned nil Installable")
+	}
+
+	got, ok := Get("test-manifest-valid")
+	if !ok {
+		t.Fatal("manifest was not registered under its Name")
+	}
+	if got != tpl {
+		t.Fatal("Get returned a different Installable than loadManifest")
+	}
+}
+
+func TestLoadManifestRejectsWrongOverallDigest(t *testing.T) {
+	body := []byte(validManifestYAML)
+	_, e := loadManifest(body, "0000000000000000000000000000000000000000000000000000000000000000")
+	if e == nil {
+		t.Fatal("expected an error for a manifest whose body doesn't match manifestSHA256")
+	}
+}
+
+func TestLoadManifestRejectsWrongVersion(t *testing.T) {
+	body := []byte(strings.Replace(validManifestYAML, "version: 1", "version: 2", 1))
+	_, e := loadManifest(body, manifestSHA256(body))
+	if e == nil {
+		t.Fatal("expected an error for an unsupported manifest schema version")
+	}
+}
+
+func TestLoadManifestRejectsMissingName(t *testing.T) {
+	body := []byte(strings.Replace(validManifestYAML, "name: test-manifest-valid", "name: \"\"", 1))
+	_, e := loadManifest(body, manifestSHA256(body))
+	if e == nil {
+		t.Fatal("expected an error for a manifest with no name")
+	}
+}
+
+func TestLoadManifestRejectsFileWithoutSHA256(t *testing.T) {
+	const manifest = `
+version: 1
+name: test-manifest-no-file-sha
+files:
+  - path: /opt/app/config.yml
+    uri: https://example.invalid/config.yml
+    owner: root
+`
+	body := []byte(manifest)
+	_, e := loadManifest(body, manifestSHA256(body))
+	if e == nil {
+		t.Fatal("expected an error for a manifest file entry with no sha256")
+	}
+}
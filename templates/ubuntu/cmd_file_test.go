@@ -0,0 +1,98 @@
+package ubuntu
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileCommandShellVerifiesDecodedDigestWhenExpectedSHA256Set(t *testing.T) {
+	fc := &FileCommand{Path: "/etc/app.conf", Content: "hello", ExpectedSHA256: "deadbeef"}
+
+	shell := fc.Shell()
+
+	shortCircuit := `if [ "$(sha256sum /etc/app.conf 2>/dev/null | cut -d' ' -f1)" = "deadbeef" ]; then exit 0; fi`
+	if !strings.HasPrefix(shell, shortCircuit) {
+		t.Fatalf("Shell() should short-circuit against ExpectedSHA256 first:\n%s", shell)
+	}
+
+	decode := strings.Index(shell, "base64 -d")
+	verify := strings.Index(shell, `sha256sum /tmp/wunderscale`)
+	mv := strings.LastIndex(shell, "mv /tmp/wunderscale")
+	if decode < 0 || verify < 0 || mv < 0 {
+		t.Fatalf("Shell() missing decode/verify/mv steps:\n%s", shell)
+	}
+	if !(decode < verify && verify < mv) {
+		t.Fatalf("Shell() steps out of order (decode=%d verify=%d mv=%d):\n%s", decode, verify, mv, shell)
+	}
+	if !strings.Contains(shell[verify:], `= "deadbeef" ]`) {
+		t.Fatalf("Shell() re-verify should check against ExpectedSHA256 %q:\n%s", "deadbeef", shell)
+	}
+}
+
+func TestFileCommandShellSkipsReVerifyWhenNotRequested(t *testing.T) {
+	fc := &FileCommand{Path: "/etc/app.conf", Content: "hello"}
+
+	shell := fc.Shell()
+
+	if strings.Count(shell, "sha256sum") != 1 {
+		t.Fatalf("Shell() without Verify/ExpectedSHA256 should only sha256sum the short-circuit check, got:\n%s", shell)
+	}
+}
+
+func TestWriteFileWithChecksumForcesVerify(t *testing.T) {
+	fc := WriteFileWithChecksum("/etc/app.conf", "hello", "deadbeef", "root", 0644)
+
+	if !fc.Verify {
+		t.Fatal("WriteFileWithChecksum must force Verify on")
+	}
+
+	shell := fc.Shell()
+	if strings.Count(shell, "sha256sum") != 2 {
+		t.Fatalf("Shell() should sha256sum once for the short-circuit and once for the re-verify, got:\n%s", shell)
+	}
+}
+
+func TestFileSendCommandShellSingleShotVerifiesAgainstSourceDigest(t *testing.T) {
+	fh, e := ioutil.TempFile("", "fsc-test-")
+	if e != nil {
+		t.Fatalf("TempFile: %v", e)
+	}
+	defer os.Remove(fh.Name())
+	fh.WriteString("payload")
+	fh.Close()
+
+	fsc := &FileSendCommand{Source: fh.Name(), Target: "/opt/app.bin", Owner: "root", Verify: true}
+	shell := fsc.Shell()
+
+	digest := fsc.sourceSHA256()
+	catIdx := strings.Index(shell, "cat - > /opt/app.bin")
+	verifyIdx := strings.Index(shell, "sha256sum /opt/app.bin | cut")
+	if catIdx < 0 || verifyIdx < 0 {
+		t.Fatalf("Shell() missing transfer/verify steps:\n%s", shell)
+	}
+	if catIdx > verifyIdx {
+		t.Fatalf("Shell() should verify after the transfer, not before:\n%s", shell)
+	}
+	if !strings.Contains(shell, digest) {
+		t.Fatalf("Shell() should re-verify against the source digest %q:\n%s", digest, shell)
+	}
+}
+
+func TestFileSendCommandShellSkipsVerifyWhenNotRequested(t *testing.T) {
+	fh, e := ioutil.TempFile("", "fsc-test-")
+	if e != nil {
+		t.Fatalf("TempFile: %v", e)
+	}
+	defer os.Remove(fh.Name())
+	fh.WriteString("payload")
+	fh.Close()
+
+	fsc := &FileSendCommand{Source: fh.Name(), Target: "/opt/app.bin"}
+	shell := fsc.Shell()
+
+	if strings.Count(shell, "sha256sum") != 1 {
+		t.Fatalf("Shell() without Verify should only sha256sum the short-circuit check, got:\n%s", shell)
+	}
+}
@@ -0,0 +1,21 @@
+package ubuntu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/megamsys/libmegdc/templates"
+)
+
+// HOST is the Template.Options key carrying the target's host IP, the
+// same key alpine's templates read.
+const HOST = "host"
+
+// InstallPackages returns a command that installs the given apt package
+// names on the target using "apt-get install -y".
+func InstallPackages(pkgs ...string) *templates.ShellCommand {
+	return &templates.ShellCommand{
+		Cmd:     fmt.Sprintf("apt-get install -y %s", strings.Join(pkgs, " ")),
+		LogLine: fmt.Sprintf("[APT    ] %s", strings.Join(pkgs, " ")),
+	}
+}